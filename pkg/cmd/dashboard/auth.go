@@ -0,0 +1,403 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/browser"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dashboardAuthAnnotation on the dashboard Service picks the AuthProvider to use when
+// --auth is not set explicitly.
+const dashboardAuthAnnotation = "jenkins-x.io/dashboard-auth"
+
+const (
+	authProviderBasic          = "basic"
+	authProviderToken          = "token"
+	authProviderServiceAccount = "serviceaccount"
+	authProviderOIDC           = "oidc"
+)
+
+// AuthProvider enriches a discovered dashboard URL with whatever credentials it needs, in
+// whatever form the browser can actually use (embedded in the URL, or via a local
+// reverse-proxy for schemes the URL can't carry, such as bearer tokens).
+type AuthProvider interface {
+	// Apply returns the URL that should be opened in the browser, and whether the caller
+	// needs to keep the process alive afterwards to serve a local proxy.
+	Apply(o *Options, rawURL string) (string, bool, error)
+}
+
+// applyAuth picks an AuthProvider - from --auth, falling back to the dashboardAuthAnnotation
+// on the Service, falling back to basic auth - and applies it to rawURL.
+func (o *Options) applyAuth(rawURL string) (string, bool, error) {
+	svc, err := o.KubeClient.CoreV1().Services(o.Namespace).Get(context.Background(), o.serviceName(), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return rawURL, false, fmt.Errorf("failed to load Service %s in namespace %s: %w", o.serviceName(), o.Namespace, err)
+	}
+
+	providerName := o.Auth
+	if providerName == "" && svc != nil {
+		providerName = svc.Annotations[dashboardAuthAnnotation]
+	}
+	if providerName == "" {
+		providerName = authProviderBasic
+	}
+
+	provider, err := newAuthProvider(providerName)
+	if err != nil {
+		return rawURL, false, err
+	}
+	return provider.Apply(o, rawURL)
+}
+
+func newAuthProvider(name string) (AuthProvider, error) {
+	switch name {
+	case authProviderBasic:
+		return &BasicAuthProvider{}, nil
+	case authProviderToken:
+		return &TokenAuthProvider{}, nil
+	case authProviderServiceAccount:
+		return &ServiceAccountAuthProvider{}, nil
+	case authProviderOIDC:
+		return &OIDCAuthProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown --auth provider %q, expected one of: basic, token, serviceaccount, oidc", name)
+	}
+}
+
+// BasicAuthProvider embeds HTTP basic-auth credentials, loaded from o.BasicAuthSecretName,
+// directly into the URL.
+type BasicAuthProvider struct{}
+
+func (p *BasicAuthProvider) Apply(o *Options, rawURL string) (string, bool, error) {
+	name := o.BasicAuthSecretName
+	ns := o.Namespace
+	secret, err := o.KubeClient.CoreV1().Secrets(ns).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return rawURL, false, fmt.Errorf("failed to load Secret %s in namespace %s: %w", name, ns, err)
+	}
+	// A missing Secret can come back as nil alongside the NotFound error.
+	var data map[string][]byte
+	if secret != nil {
+		data = secret.Data
+	}
+	username := string(data["username"])
+	password := string(data["password"])
+
+	if username == "" {
+		log.Logger().Warnf("secret %s in namespace %s has no username", name, ns)
+		return rawURL, false, nil
+	}
+	if password == "" {
+		log.Logger().Warnf("secret %s in namespace %s has no password", name, ns)
+		return rawURL, false, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL, false, fmt.Errorf("failed to parse URL %s: %w", rawURL, err)
+	}
+	u.User = url.UserPassword(username, password)
+	return u.String(), false, nil
+}
+
+// TokenAuthProvider injects a bearer token, loaded from o.TokenSecretName/o.TokenSecretKey,
+// as an Authorization header via a local reverse-proxy.
+type TokenAuthProvider struct{}
+
+func (p *TokenAuthProvider) Apply(o *Options, rawURL string) (string, bool, error) {
+	name := o.TokenSecretName
+	if name == "" {
+		return rawURL, false, fmt.Errorf("--token-secret must be set to use --auth=token")
+	}
+	secret, err := o.KubeClient.CoreV1().Secrets(o.Namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return rawURL, false, fmt.Errorf("failed to load Secret %s in namespace %s: %w", name, o.Namespace, err)
+	}
+	token := string(secret.Data[o.TokenSecretKey])
+	if token == "" {
+		return rawURL, false, fmt.Errorf("secret %s in namespace %s has no key %s", name, o.Namespace, o.TokenSecretKey)
+	}
+
+	proxyURL, err := startBearerTokenProxy(rawURL, token)
+	if err != nil {
+		return rawURL, false, err
+	}
+	return proxyURL, true, nil
+}
+
+// ServiceAccountAuthProvider mints a short-lived ServiceAccount token via the TokenRequest API
+// and injects it as an Authorization header via a local reverse-proxy.
+type ServiceAccountAuthProvider struct{}
+
+func (p *ServiceAccountAuthProvider) Apply(o *Options, rawURL string) (string, bool, error) {
+	name := o.ServiceAccountName
+	if name == "" {
+		name = "default"
+	}
+	tr, err := o.KubeClient.CoreV1().ServiceAccounts(o.Namespace).CreateToken(context.Background(), name, &authenticationv1.TokenRequest{}, metav1.CreateOptions{})
+	if err != nil {
+		return rawURL, false, fmt.Errorf("failed to create a token for ServiceAccount %s in namespace %s: %w", name, o.Namespace, err)
+	}
+
+	proxyURL, err := startBearerTokenProxy(rawURL, tr.Status.Token)
+	if err != nil {
+		return rawURL, false, err
+	}
+	return proxyURL, true, nil
+}
+
+// OIDCAuthProvider runs an OIDC device-authorization flow against the issuer/clientID found
+// in o.OIDCConfigMapName, caching the resulting token on disk, and injects it as an
+// Authorization header via a local reverse-proxy.
+type OIDCAuthProvider struct{}
+
+// oidcTokenCache is the on-disk cache written to ~/.jx/cache/dashboard-token.
+type oidcTokenCache struct {
+	IssuerURL   string    `json:"issuerURL"`
+	ClientID    string    `json:"clientID"`
+	AccessToken string    `json:"accessToken"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+type oidcDiscoveryDocument struct {
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+}
+
+type oidcDeviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	Error       string `json:"error"`
+}
+
+func (p *OIDCAuthProvider) Apply(o *Options, rawURL string) (string, bool, error) {
+	cm, err := o.KubeClient.CoreV1().ConfigMaps(o.Namespace).Get(context.Background(), o.OIDCConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return rawURL, false, fmt.Errorf("failed to load ConfigMap %s in namespace %s: %w", o.OIDCConfigMapName, o.Namespace, err)
+	}
+	issuerURL := cm.Data["issuer"]
+	clientID := cm.Data["clientId"]
+	if issuerURL == "" || clientID == "" {
+		return rawURL, false, fmt.Errorf("ConfigMap %s in namespace %s must have 'issuer' and 'clientId' entries", o.OIDCConfigMapName, o.Namespace)
+	}
+
+	token, err := oidcToken(issuerURL, clientID)
+	if err != nil {
+		return rawURL, false, err
+	}
+
+	proxyURL, err := startBearerTokenProxy(rawURL, token)
+	if err != nil {
+		return rawURL, false, err
+	}
+	return proxyURL, true, nil
+}
+
+// oidcToken returns a cached access token for issuerURL/clientID if one is still valid,
+// otherwise it runs the device-authorization flow and caches the result.
+func oidcToken(issuerURL, clientID string) (string, error) {
+	cacheFile, err := oidcCacheFile()
+	if err == nil {
+		if cached, ok := readOIDCCache(cacheFile, issuerURL, clientID); ok {
+			return cached.AccessToken, nil
+		}
+	}
+
+	doc, err := fetchOIDCDiscoveryDocument(issuerURL)
+	if err != nil {
+		return "", err
+	}
+
+	deviceCode, err := startOIDCDeviceAuthorization(doc.DeviceAuthorizationEndpoint, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	verificationURL := deviceCode.VerificationURIComplete
+	if verificationURL == "" {
+		verificationURL = deviceCode.VerificationURI
+	}
+	log.Logger().Infof("opening %s to sign in and authorize the dashboard", info(verificationURL))
+	if err := browser.OpenURL(verificationURL); err != nil {
+		log.Logger().Warnf("failed to open browser, please visit %s and enter code %s", verificationURL, deviceCode.UserCode)
+	}
+
+	token, expiresIn, err := pollOIDCToken(doc.TokenEndpoint, clientID, deviceCode)
+	if err != nil {
+		return "", err
+	}
+
+	if cacheFile != "" {
+		writeOIDCCache(cacheFile, oidcTokenCache{
+			IssuerURL:   issuerURL,
+			ClientID:    clientID,
+			AccessToken: token,
+			ExpiresAt:   time.Now().Add(time.Duration(expiresIn) * time.Second),
+		})
+	}
+	return token, nil
+}
+
+func oidcCacheFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve home directory: %w", err)
+	}
+	return filepath.Join(home, ".jx", "cache", "dashboard-token"), nil
+}
+
+func readOIDCCache(cacheFile, issuerURL, clientID string) (oidcTokenCache, bool) {
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		return oidcTokenCache{}, false
+	}
+	var cached oidcTokenCache
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return oidcTokenCache{}, false
+	}
+	if cached.IssuerURL != issuerURL || cached.ClientID != clientID {
+		return oidcTokenCache{}, false
+	}
+	if cached.AccessToken == "" || !time.Now().Before(cached.ExpiresAt) {
+		return oidcTokenCache{}, false
+	}
+	return cached, true
+}
+
+func writeOIDCCache(cacheFile string, cached oidcTokenCache) {
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0o700); err != nil {
+		log.Logger().Warnf("failed to create cache directory for %s: %s", cacheFile, err.Error())
+		return
+	}
+	data, err := json.Marshal(cached)
+	if err != nil {
+		log.Logger().Warnf("failed to marshal dashboard token cache: %s", err.Error())
+		return
+	}
+	if err := os.WriteFile(cacheFile, data, 0o600); err != nil {
+		log.Logger().Warnf("failed to write dashboard token cache to %s: %s", cacheFile, err.Error())
+	}
+}
+
+func fetchOIDCDiscoveryDocument(issuerURL string) (*oidcDiscoveryDocument, error) {
+	resp, err := http.Get(strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC discovery document from %s: %w", issuerURL, err)
+	}
+	defer resp.Body.Close()
+
+	var doc oidcDiscoveryDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OIDC discovery document from %s: %w", issuerURL, err)
+	}
+	return &doc, nil
+}
+
+func startOIDCDeviceAuthorization(deviceAuthorizationEndpoint, clientID string) (*oidcDeviceCodeResponse, error) {
+	resp, err := http.PostForm(deviceAuthorizationEndpoint, url.Values{"client_id": {clientID}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start OIDC device authorization: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var dc oidcDeviceCodeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&dc); err != nil {
+		return nil, fmt.Errorf("failed to parse OIDC device authorization response: %w", err)
+	}
+	return &dc, nil
+}
+
+func pollOIDCToken(tokenEndpoint, clientID string, deviceCode *oidcDeviceCodeResponse) (string, int, error) {
+	interval := time.Duration(deviceCode.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(deviceCode.ExpiresIn) * time.Second)
+
+	for {
+		if time.Now().After(deadline) {
+			return "", 0, fmt.Errorf("timed out waiting for the OIDC device code to be authorized")
+		}
+		time.Sleep(interval)
+
+		resp, err := http.PostForm(tokenEndpoint, url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {deviceCode.DeviceCode},
+			"client_id":   {clientID},
+		})
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to poll OIDC token endpoint: %w", err)
+		}
+
+		var tr oidcTokenResponse
+		decodeErr := json.NewDecoder(resp.Body).Decode(&tr)
+		resp.Body.Close()
+		if decodeErr != nil {
+			return "", 0, fmt.Errorf("failed to parse OIDC token response: %w", decodeErr)
+		}
+
+		switch tr.Error {
+		case "":
+			return tr.AccessToken, tr.ExpiresIn, nil
+		case "authorization_pending", "slow_down":
+			continue
+		default:
+			return "", 0, fmt.Errorf("OIDC device authorization failed: %s", tr.Error)
+		}
+	}
+}
+
+// startBearerTokenProxy starts a local reverse-proxy forwarding to rawURL which injects
+// "Authorization: Bearer <token>" on every request, since a browser can't be told to add a
+// header when simply opening a URL. It returns the local URL to open instead.
+func startBearerTokenProxy(rawURL, token string) (string, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL %s: %w", rawURL, err)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to start local auth proxy: %w", err)
+	}
+	server := &http.Server{Handler: proxy}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Logger().Debugf("local auth proxy stopped: %s", err.Error())
+		}
+	}()
+
+	// The proxy already prefixes target.Path onto every request path, so the root of the
+	// local listener maps to rawURL.
+	return fmt.Sprintf("http://%s/", listener.Addr().String()), nil
+}
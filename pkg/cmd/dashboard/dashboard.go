@@ -1,9 +1,21 @@
 package dashboard
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
+	"time"
 
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
@@ -22,15 +34,61 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
+// kubectlProxyAddressPattern matches the "Starting to serve on 127.0.0.1:NNNNN" line
+// that `kubectl proxy` writes to stdout once it has bound to a port.
+var kubectlProxyAddressPattern = regexp.MustCompile(`127\.0\.0\.1:\d{4,}`)
+
+// kubectlProxyStartTimeout is how long we wait for `kubectl proxy` to report its bound port.
+const kubectlProxyStartTimeout = 10 * time.Second
+
+// defaultWaitInterval is the polling interval used by WaitForService when --interval is not set.
+const defaultWaitInterval = 5 * time.Second
+
+// defaultURLFormat is the text/template applied to each discovered ServiceURL when --format
+// is not set.
+const defaultURLFormat = "{{.Scheme}}://{{.IP}}{{if .Port}}:{{.Port}}{{end}}{{.Path}}"
+
 type Options struct {
 	options.BaseOptions
 	KubeClient          kubernetes.Interface
 	Namespace           string
-	ServiceName         string
+	ServiceNames        []string
 	BasicAuthSecretName string
 	NoBrowser           bool
 	Quiet               bool
+	Proxy               bool
+	Wait                time.Duration
+	Interval            time.Duration
+	Format              string
+	HTTPS               bool
+	Auth                string
+	TokenSecretName     string
+	TokenSecretKey      string
+	ServiceAccountName  string
+	OIDCConfigMapName   string
 	BrowserHandler      Opener
+
+	proxyCmd *exec.Cmd
+}
+
+// ServiceURL is a discovered dashboard service URL, broken down into the fields available
+// to the --format template as well as the fully rendered URL.
+type ServiceURL struct {
+	Name   string
+	Scheme string
+	IP     string
+	Port   string
+	Path   string
+	URL    string
+}
+
+// serviceName returns the primary (first) configured service name, used by the
+// single-service wait/proxy/auth flow.
+func (o *Options) serviceName() string {
+	if len(o.ServiceNames) == 0 {
+		return ""
+	}
+	return o.ServiceNames[0]
 }
 
 type Opener interface {
@@ -80,8 +138,18 @@ func NewCmdDashboard() (*cobra.Command, *Options) {
 	}
 
 	cmd.Flags().BoolVarP(&o.NoBrowser, "no-open", "", false, "Disable opening the URL; just show it on the console")
-	cmd.Flags().StringVarP(&o.ServiceName, "name", "n", "jx-pipelines-visualizer", "The name of the dashboard service")
+	cmd.Flags().StringArrayVarP(&o.ServiceNames, "name", "n", []string{"jx-pipelines-visualizer"}, "The name of the dashboard service. Can be repeated to discover multiple services, e.g. -n jx-pipelines-visualizer -n jenkins")
 	cmd.Flags().StringVarP(&o.BasicAuthSecretName, "secret", "s", "jx-basic-auth-user-password", "The name of the Secret containing the basic auth login/password")
+	cmd.Flags().BoolVarP(&o.Proxy, "proxy", "", false, "Use 'kubectl proxy' to reach the dashboard service instead of looking up an Ingress/LoadBalancer URL. Used automatically if no external URL can be found")
+	cmd.Flags().DurationVarP(&o.Wait, "wait", "w", 0, "How long to wait for the dashboard service to become ready before giving up, e.g. 60s, 2m. Defaults to not waiting")
+	cmd.Flags().DurationVarP(&o.Interval, "interval", "", defaultWaitInterval, "The polling interval to use while waiting for the dashboard service to become ready")
+	cmd.Flags().StringVarP(&o.Format, "format", "", defaultURLFormat, "A Go text/template string used to render each discovered service URL. Available fields: .Name .Scheme .IP .Port .Path")
+	cmd.Flags().BoolVarP(&o.HTTPS, "https", "", false, "Rewrite the scheme of discovered URLs to https")
+	cmd.Flags().StringVarP(&o.Auth, "auth", "", "", "Override the auth provider used to access the dashboard: basic, token, serviceaccount or oidc. Defaults to the service's jenkins-x.io/dashboard-auth annotation, or basic")
+	cmd.Flags().StringVarP(&o.TokenSecretName, "token-secret", "", "", "The name of the Secret containing a bearer token to use when --auth=token")
+	cmd.Flags().StringVarP(&o.TokenSecretKey, "token-key", "", "token", "The key within --token-secret containing the bearer token")
+	cmd.Flags().StringVarP(&o.ServiceAccountName, "service-account", "", "default", "The ServiceAccount to mint a token for when --auth=serviceaccount")
+	cmd.Flags().StringVarP(&o.OIDCConfigMapName, "oidc-configmap", "", "jx-dashboard-oidc", "The name of the ConfigMap containing the 'issuer' and 'clientId' used when --auth=oidc")
 	o.BaseOptions.AddBaseFlags(cmd)
 	return cmd, o
 }
@@ -92,65 +160,307 @@ func (o *Options) Run() error {
 	if err != nil {
 		return fmt.Errorf("creating kubernetes client: %w", err)
 	}
-	client := o.KubeClient
 
-	u, err := services.FindServiceURL(client, o.Namespace, o.ServiceName)
+	if len(o.ServiceNames) > 1 {
+		if o.Wait > 0 || o.Proxy || o.Auth != "" {
+			return fmt.Errorf("--wait, --proxy and --auth are not supported together with multiple --name values")
+		}
+		return o.runMultiService()
+	}
+
+	u, err := o.WaitForService()
 	if err != nil {
-		return fmt.Errorf("failed to find dashboard URL. Check you have 'chart: jxgh/jx-pipelines-visualizer' in your helmfile.yaml: %w", err)
+		return err
+	}
+
+	usingProxy := o.Proxy
+	if u == "" {
+		log.Logger().Infof("no external URL found for service %s, falling back to %s", info(o.serviceName()), info("kubectl proxy"))
+		usingProxy = true
+	}
+	if usingProxy {
+		u, err = o.startKubectlProxy()
+		if err != nil {
+			return fmt.Errorf("failed to start kubectl proxy fallback: %w", err)
+		}
+		defer o.stopKubectlProxy()
 	}
 	if u == "" {
 		return fmt.Errorf("no dashboard URL. Check you have 'chart: jxgh/jx-pipelines-visualizer' in your helmfile.yaml")
 	}
 
-	log.Logger().Infof("Jenkins X dashboard is running at: %s", info(u))
-
-	if o.NoBrowser {
-		return nil
+	su, err := o.renderServiceURL(o.serviceName(), u)
+	if err != nil {
+		return err
 	}
+	u = su.URL
 
-	u, err = o.addUserPasswordToURL(u)
+	u, authKeepAlive, err := o.applyAuth(u)
 	if err != nil {
 		return fmt.Errorf("failed to enrich dashboard URL %s: %w", u, err)
 	}
 
-	log.Logger().Debugf("opening: %s", info(u))
+	log.Logger().Infof("Jenkins X dashboard is running at: %s", info(u))
+
+	if !o.NoBrowser {
+		log.Logger().Debugf("opening: %s", info(u))
+
+		if o.BrowserHandler == nil {
+			o.BrowserHandler = &Browser{u}
+		}
+		if err := o.BrowserHandler.Open(); err != nil {
+			return err
+		}
+	}
 
-	if o.BrowserHandler == nil {
-		o.BrowserHandler = &Browser{u}
+	// Keep the kubectl proxy / auth reverse-proxy alive for the caller to use even when
+	// --no-open is set - that's the only way to get a working, curl-able URL out of it.
+	if usingProxy || authKeepAlive {
+		o.waitForInterrupt()
 	}
-	err = o.BrowserHandler.Open()
+	return nil
+}
+
+// runMultiService renders the URLs for every configured --name and either prints them as a
+// table (when --no-open is set) or opens each one in its own browser tab.
+func (o *Options) runMultiService() error {
+	urls, err := o.RenderURLs()
 	if err != nil {
 		return err
 	}
+	if len(urls) == 0 {
+		return fmt.Errorf("no dashboard URLs found for services %v in namespace %s", o.ServiceNames, o.Namespace)
+	}
+
+	if o.NoBrowser {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tURL")
+		for _, su := range urls {
+			fmt.Fprintf(w, "%s\t%s\n", su.Name, su.URL)
+		}
+		return w.Flush()
+	}
+
+	for _, su := range urls {
+		log.Logger().Infof("opening %s at: %s", info(su.Name), info(su.URL))
+		handler := o.BrowserHandler
+		if handler == nil {
+			handler = &Browser{su.URL}
+		}
+		if err := handler.Open(); err != nil {
+			return fmt.Errorf("failed to open %s: %w", su.URL, err)
+		}
+	}
 	return nil
 }
 
-func (o *Options) addUserPasswordToURL(urlText string) (string, error) {
-	name := o.BasicAuthSecretName
-	ns := o.Namespace
-	secret, err := o.KubeClient.CoreV1().Secrets(ns).Get(context.Background(), name, metav1.GetOptions{})
-	if err != nil && !apierrors.IsNotFound(err) {
-		return urlText, fmt.Errorf("failed to load Secret %s in namespace %s: %w", name, ns, err)
+// RenderURLs discovers the URL of every configured --name service and renders it through the
+// --format template, applying --https if set. Other commands can reuse this to discover and
+// render a set of related service URLs.
+func (o *Options) RenderURLs() ([]ServiceURL, error) {
+	var err error
+	o.KubeClient, o.Namespace, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, o.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("creating kubernetes client: %w", err)
 	}
-	if secret.Data == nil {
-		secret.Data = map[string][]byte{}
+
+	names := o.ServiceNames
+	if len(names) == 0 {
+		names = []string{"jx-pipelines-visualizer"}
 	}
-	username := string(secret.Data["username"])
-	password := string(secret.Data["password"])
 
-	if username == "" {
-		log.Logger().Warnf("secret %s in namespace %s has no username", name, ns)
-		return urlText, nil
+	var urls []ServiceURL
+	for _, name := range names {
+		raw, err := services.FindServiceURL(o.KubeClient, o.Namespace, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find URL for service %s. Check you have 'chart: jxgh/jx-pipelines-visualizer' in your helmfile.yaml: %w", name, err)
+		}
+		if raw == "" {
+			log.Logger().Warnf("no external URL found for service %s in namespace %s", name, o.Namespace)
+			continue
+		}
+		su, err := o.renderServiceURL(name, raw)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, su)
 	}
-	if password == "" {
-		log.Logger().Warnf("secret %s in namespace %s has no password", name, ns)
-		return urlText, nil
+	return urls, nil
+}
+
+// renderServiceURL breaks rawURL into the fields available to the --format template,
+// renders it, and applies the --https scheme override.
+func (o *Options) renderServiceURL(name, rawURL string) (ServiceURL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ServiceURL{}, fmt.Errorf("failed to parse discovered URL %s for service %s: %w", rawURL, name, err)
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	scheme := u.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	if o.HTTPS && !isLocalProxyHost(u.Hostname()) {
+		scheme = "https"
+	}
+	su := ServiceURL{Name: name, Scheme: scheme, IP: u.Hostname(), Port: u.Port(), Path: path}
+
+	format := o.Format
+	if format == "" {
+		format = defaultURLFormat
+	}
+	tmpl, err := template.New("dashboardURL").Parse(format)
+	if err != nil {
+		return ServiceURL{}, fmt.Errorf("invalid --format template %q: %w", format, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, su); err != nil {
+		return ServiceURL{}, fmt.Errorf("failed to render URL template for service %s: %w", name, err)
+	}
+	su.URL = buf.String()
+	return su, nil
+}
+
+// isLocalProxyHost reports whether host is a loopback address, i.e. the local kubectl
+// proxy or auth reverse-proxy listeners started by this command. Those only ever serve
+// plain HTTP, so --https must not rewrite their scheme.
+func isLocalProxyHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// WaitForService looks up the dashboard service URL. If o.Wait is zero it looks it up once,
+// without checking readiness, and returns a lookup failure as an error. Otherwise it
+// retries with o.Interval until a URL is found and the Service's Endpoints are Ready, or
+// o.Wait elapses; a timeout returns "" without error so the caller can fall back to
+// kubectl proxy rather than treating a bare or not-yet-ready cluster as fatal.
+func (o *Options) WaitForService() (string, error) {
+	if o.Wait <= 0 {
+		u, err := services.FindServiceURL(o.KubeClient, o.Namespace, o.serviceName())
+		if err != nil {
+			return "", fmt.Errorf("failed to find dashboard URL. Check you have 'chart: jxgh/jx-pipelines-visualizer' in your helmfile.yaml: %w", err)
+		}
+		return u, nil
+	}
+
+	interval := o.Interval
+	if interval <= 0 {
+		interval = defaultWaitInterval
+	}
+	deadline := time.Now().Add(o.Wait)
+	for {
+		u, err := services.FindServiceURL(o.KubeClient, o.Namespace, o.serviceName())
+		if err == nil && u != "" {
+			ready, rerr := o.endpointsReady()
+			if rerr == nil && ready {
+				return u, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			log.Logger().Warnf("timed out after %s waiting for service %s in namespace %s to become ready, check the pods with: kubectl get pods -n %s", o.Wait, o.serviceName(), o.Namespace, o.Namespace)
+			return "", nil
+		}
+		time.Sleep(interval)
+	}
+}
+
+// endpointsReady returns true if the dashboard Service has at least one backing Endpoints
+// address marked Ready.
+func (o *Options) endpointsReady() (bool, error) {
+	ep, err := o.KubeClient.CoreV1().Endpoints(o.Namespace).Get(context.Background(), o.serviceName(), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to load Endpoints %s in namespace %s: %w", o.serviceName(), o.Namespace, err)
+	}
+	for _, subset := range ep.Subsets {
+		if len(subset.Addresses) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// startKubectlProxy spawns `kubectl proxy` bound to a random localhost port and returns
+// the URL of the dashboard service as served through that proxy.
+func (o *Options) startKubectlProxy() (string, error) {
+	cmd := exec.Command("kubectl", "proxy", "--port=0")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", fmt.Errorf("failed to create stdout pipe for kubectl proxy: %w", err)
+	}
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start kubectl proxy: %w", err)
+	}
+	o.proxyCmd = cmd
+
+	portCh := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if addr := kubectlProxyAddressPattern.FindString(scanner.Text()); addr != "" {
+				portCh <- addr[len("127.0.0.1:"):]
+				return
+			}
+		}
+		close(portCh)
+	}()
+
+	select {
+	case port, ok := <-portCh:
+		if !ok {
+			o.stopKubectlProxy()
+			return "", fmt.Errorf("kubectl proxy exited before reporting a bound port")
+		}
+		return o.buildProxyURL(port)
+	case <-time.After(kubectlProxyStartTimeout):
+		o.stopKubectlProxy()
+		return "", fmt.Errorf("timed out waiting for kubectl proxy to report its bound port")
 	}
+}
 
-	u, err := url.Parse(urlText)
+// buildProxyURL builds the apiserver proxy subresource URL for the dashboard service
+// given the local port that `kubectl proxy` is listening on.
+func (o *Options) buildProxyURL(port string) (string, error) {
+	svc, err := o.KubeClient.CoreV1().Services(o.Namespace).Get(context.Background(), o.serviceName(), metav1.GetOptions{})
 	if err != nil {
-		return urlText, fmt.Errorf("failed to parse URL %s: %w", urlText, err)
+		return "", fmt.Errorf("failed to load Service %s in namespace %s: %w", o.serviceName(), o.Namespace, err)
+	}
+	if len(svc.Spec.Ports) == 0 {
+		return "", fmt.Errorf("service %s in namespace %s has no ports", o.serviceName(), o.Namespace)
+	}
+	portName := svc.Spec.Ports[0].Name
+	if portName == "" {
+		portName = strconv.Itoa(int(svc.Spec.Ports[0].Port))
 	}
-	u.User = url.UserPassword(username, password)
-	return u.String(), nil
+	return fmt.Sprintf("http://127.0.0.1:%s/api/v1/namespaces/%s/services/%s:%s/proxy/", port, o.Namespace, o.serviceName(), portName), nil
+}
+
+// stopKubectlProxy terminates a previously started kubectl proxy process, if any.
+func (o *Options) stopKubectlProxy() {
+	if o.proxyCmd == nil || o.proxyCmd.Process == nil {
+		return
+	}
+	_ = o.proxyCmd.Process.Signal(syscall.SIGINT)
+	_ = o.proxyCmd.Wait()
+	o.proxyCmd = nil
+}
+
+// waitForInterrupt blocks, keeping any kubectl proxy or local auth reverse-proxy alive for
+// the lifetime of the browser session, until the user presses Ctrl-C.
+func (o *Options) waitForInterrupt() {
+	log.Logger().Info("keeping the local proxy running, press ctrl-c to stop")
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	<-sigCh
+	signal.Stop(sigCh)
 }
@@ -0,0 +1,175 @@
+package dashboard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBuildProxyURL(t *testing.T) {
+	o := &Options{
+		Namespace:    "jx",
+		ServiceNames: []string{"jx-pipelines-visualizer"},
+		KubeClient: fake.NewSimpleClientset(&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "jx-pipelines-visualizer", Namespace: "jx"},
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{{Name: "http", Port: 80}},
+			},
+		}),
+	}
+
+	u, err := o.buildProxyURL("8080")
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8080/api/v1/namespaces/jx/services/jx-pipelines-visualizer:http/proxy/", u)
+}
+
+func TestBuildProxyURLNoPorts(t *testing.T) {
+	o := &Options{
+		Namespace:    "jx",
+		ServiceNames: []string{"jx-pipelines-visualizer"},
+		KubeClient: fake.NewSimpleClientset(&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "jx-pipelines-visualizer", Namespace: "jx"},
+		}),
+	}
+
+	_, err := o.buildProxyURL("8080")
+	require.Error(t, err)
+}
+
+func TestStopKubectlProxyWithoutStartIsNoOp(t *testing.T) {
+	o := &Options{}
+	o.stopKubectlProxy()
+}
+
+func TestRenderServiceURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		rawURL string
+		https  bool
+		want   string
+	}{
+		{
+			name:   "http ingress URL with no explicit port",
+			rawURL: "http://jx-pipelines-visualizer.example.com",
+			want:   "http://jx-pipelines-visualizer.example.com/",
+		},
+		{
+			name:   "https ingress URL is preserved by default",
+			rawURL: "https://jx-pipelines-visualizer.example.com/dashboard",
+			want:   "https://jx-pipelines-visualizer.example.com/dashboard",
+		},
+		{
+			name:   "explicit port is rendered",
+			rawURL: "http://10.0.0.1:8080",
+			want:   "http://10.0.0.1:8080/",
+		},
+		{
+			name:   "--https upgrades the scheme",
+			rawURL: "http://jx-pipelines-visualizer.example.com",
+			https:  true,
+			want:   "https://jx-pipelines-visualizer.example.com/",
+		},
+		{
+			name:   "--https does not rewrite a local kubectl proxy URL",
+			rawURL: "http://127.0.0.1:8080/api/v1/namespaces/jx/services/jx-pipelines-visualizer:http/proxy/",
+			https:  true,
+			want:   "http://127.0.0.1:8080/api/v1/namespaces/jx/services/jx-pipelines-visualizer:http/proxy/",
+		},
+		{
+			name:   "--https does not rewrite a local auth reverse-proxy URL",
+			rawURL: "http://localhost:8081/",
+			https:  true,
+			want:   "http://localhost:8081/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{HTTPS: tt.https}
+			su, err := o.renderServiceURL("jx-pipelines-visualizer", tt.rawURL)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, su.URL)
+		})
+	}
+}
+
+func TestEndpointsReady(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints *corev1.Endpoints
+		want      bool
+	}{
+		{
+			name: "no endpoints object yet",
+			want: false,
+		},
+		{
+			name: "endpoints exist but have no addresses",
+			endpoints: &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: "jx-pipelines-visualizer", Namespace: "jx"},
+				Subsets:    []corev1.EndpointSubset{{}},
+			},
+			want: false,
+		},
+		{
+			name: "endpoints have a ready address",
+			endpoints: &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: "jx-pipelines-visualizer", Namespace: "jx"},
+				Subsets: []corev1.EndpointSubset{{
+					Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				}},
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := []runtime.Object{}
+			if tt.endpoints != nil {
+				objs = append(objs, tt.endpoints)
+			}
+			o := &Options{
+				Namespace:    "jx",
+				ServiceNames: []string{"jx-pipelines-visualizer"},
+				KubeClient:   fake.NewSimpleClientset(objs...),
+			}
+
+			ready, err := o.endpointsReady()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ready)
+		})
+	}
+}
+
+func TestWaitForServiceTimeoutIsNonFatal(t *testing.T) {
+	o := &Options{
+		Namespace:    "jx",
+		ServiceNames: []string{"jx-pipelines-visualizer"},
+		KubeClient:   fake.NewSimpleClientset(),
+		Wait:         20 * time.Millisecond,
+		Interval:     5 * time.Millisecond,
+	}
+
+	u, err := o.WaitForService()
+	require.NoError(t, err)
+	assert.Empty(t, u, "a --wait timeout must not be fatal, so Run can still fall back to kubectl proxy")
+}
+
+func TestRunRejectsUnsupportedFlagsWithMultipleServiceNames(t *testing.T) {
+	o := &Options{
+		ServiceNames: []string{"jx-pipelines-visualizer", "jenkins"},
+		Auth:         "token",
+		KubeClient:   fake.NewSimpleClientset(),
+	}
+
+	err := o.Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not supported together with multiple --name values")
+}